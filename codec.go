@@ -0,0 +1,275 @@
+package logsort
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// AutoDetect is a Codec name meaning "pick a codec from the file extension,
+// or failing that from a magic-byte sniff of the source". It is only
+// meaningful for reading; it has no effect on the Dst side beyond picking a
+// codec from the destination file's extension.
+const AutoDetect = "auto"
+
+/*
+	Codec wraps a compression format so SortByOption, MergeByOption and
+	friends can read and write it without hard-coding gzip. NewReader wraps
+	a raw source in a decompressing io.ReadCloser; NewWriter wraps a raw
+	destination in a compressing io.WriteCloser.
+*/
+type Codec interface {
+	NewReader(io.Reader) (io.ReadCloser, error)
+	NewWriter(io.Writer) io.WriteCloser
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{}
+)
+
+func init() {
+	RegisterCodec("gzip", gzipCodec{})
+	RegisterCodec("bzip2", bzip2Codec{})
+	RegisterCodec("zstd", zstdCodec{})
+}
+
+// RegisterCodec registers a Codec under name, making it usable as
+// Option.SrcCodec/DstCodec or MergeOption.SrcCodec/DstCodec. Registering
+// under an already-used name replaces it.
+func RegisterCodec(name string, c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	codecs[name] = c
+}
+
+func lookupCodec(name string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	c, ok := codecs[name]
+
+	return c, ok
+}
+
+// codecByExt guesses a codec name from a file's extension, or "" if none
+// match.
+func codecByExt(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		return "gzip"
+	case strings.HasSuffix(path, ".bz2"):
+		return "bzip2"
+	case strings.HasSuffix(path, ".zst"):
+		return "zstd"
+	default:
+		return ""
+	}
+}
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte{0x42, 0x5a, 0x68}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// sniffMagic guesses a codec name from up to the first 4 bytes of a
+// source, or "" if they don't match a registered codec's magic.
+func sniffMagic(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, zstdMagic):
+		return "zstd"
+	case bytes.HasPrefix(head, bzip2Magic):
+		return "bzip2"
+	case bytes.HasPrefix(head, gzipMagic):
+		return "gzip"
+	default:
+		return ""
+	}
+}
+
+// sniffCodec reads up to 4 magic bytes from fd and guesses a codec name
+// from them, restoring fd's offset afterwards. It returns "" if the magic
+// bytes don't match a registered codec.
+func sniffCodec(fd *os.File) (string, error) {
+	var magic [4]byte
+
+	n, err := io.ReadFull(fd, magic[:])
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	if _, err := fd.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return sniffMagic(magic[:n]), nil
+}
+
+// resolveSrcCodec turns a Option/MergeOption-style codec name into a Codec
+// for reading fd. An empty name means "no codec" (plain text); AutoDetect
+// first tries the file extension and falls back to sniffing fd's magic
+// bytes.
+func resolveSrcCodec(path, name string, fd *os.File) (Codec, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	if name == AutoDetect {
+		if ext := codecByExt(path); ext != "" {
+			name = ext
+		} else {
+			sniffed, err := sniffCodec(fd)
+			if err != nil {
+				return nil, errors.Wrapf(err, "sniff codec %s", path)
+			}
+
+			if sniffed == "" {
+				return nil, nil
+			}
+
+			name = sniffed
+		}
+	}
+
+	c, ok := lookupCodec(name)
+	if !ok {
+		return nil, errors.Errorf("logsort: unknown codec %q", name)
+	}
+
+	return c, nil
+}
+
+// resolveDstCodec turns a Option/MergeOption-style codec name into a Codec
+// for writing to path. AutoDetect picks a codec from path's extension, or
+// no codec if the extension doesn't match one.
+func resolveDstCodec(path, name string) (Codec, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	if name == AutoDetect {
+		name = codecByExt(path)
+		if name == "" {
+			return nil, nil
+		}
+	}
+
+	c, ok := lookupCodec(name)
+	if !ok {
+		return nil, errors.Errorf("logsort: unknown codec %q", name)
+	}
+
+	return c, nil
+}
+
+// resolveStreamSrcCodec is resolveSrcCodec's counterpart for a plain
+// io.Reader, which has neither a path nor Seek: AutoDetect can only fall
+// back to peeking br's first bytes, not a file extension.
+func resolveStreamSrcCodec(name string, br *bufio.Reader) (Codec, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	if name == AutoDetect {
+		head, _ := br.Peek(4)
+
+		sniffed := sniffMagic(head)
+		if sniffed == "" {
+			return nil, nil
+		}
+
+		name = sniffed
+	}
+
+	c, ok := lookupCodec(name)
+	if !ok {
+		return nil, errors.Errorf("logsort: unknown codec %q", name)
+	}
+
+	return c, nil
+}
+
+// DetectFileCodec opens path and returns the Codec name AutoDetect would
+// resolve it to (from its extension, falling back to a magic-byte sniff),
+// or "" if neither matches a registered codec. It's useful for callers
+// such as logsort/watch that need to know a file's compression before
+// building an Option.
+func DetectFileCodec(path string) (string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+
+	defer fd.Close()
+
+	if ext := codecByExt(path); ext != "" {
+		return ext, nil
+	}
+
+	return sniffCodec(fd)
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) }
+
+func (gzipCodec) NewWriter(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+
+// bzip2Codec is read-only, matching compress/bzip2: it has no writer.
+type bzip2Codec struct{}
+
+func (bzip2Codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bzip2.NewReader(r)), nil
+}
+
+func (bzip2Codec) NewWriter(w io.Writer) io.WriteCloser { return readOnlyWriter{} }
+
+// ErrCodecReadOnly returned by a read-only Codec's writer.
+var ErrCodecReadOnly = errors.New("logsort: codec is read-only")
+
+type readOnlyWriter struct{}
+
+func (readOnlyWriter) Write(p []byte) (int, error) { return 0, ErrCodecReadOnly }
+
+func (readOnlyWriter) Close() error { return nil }
+
+// errWriter reports a fixed error from every Write/Close. Unlike
+// readOnlyWriter, it doesn't mean "this codec has no writer" — it means a
+// writer failed to initialize, so the original error is worth surfacing
+// instead of being conflated with ErrCodecReadOnly.
+type errWriter struct{ err error }
+
+func (e errWriter) Write(p []byte) (int, error) { return 0, e.err }
+
+func (e errWriter) Close() error { return e.err }
+
+type zstdCodec struct{}
+
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	dec, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return dec.IOReadCloser(), nil
+}
+
+func (zstdCodec) NewWriter(w io.Writer) io.WriteCloser {
+	enc, err := zstd.NewWriter(w)
+	if err != nil {
+		return errWriter{err: errors.Wrap(err, "new zstd writer")}
+	}
+
+	return enc
+}
@@ -0,0 +1,107 @@
+package logsort
+
+import (
+	"bufio"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+/*
+	scanLines is the scan/sort half of the core shared by SortByOption's
+	plain path and SortReaderByOption: it drains scanner, applies getTime
+	to each line and reports progress, then sorts the result by timestamp.
+
+	When bufferContent is true, every line's bytes are copied into
+	lineUnit.content; this is the only option for a Reader-backed source,
+	which can't be seeked back into later. When false, lineUnit.offset and
+	.length are recorded instead, for a caller that can ReadAt the original
+	file at write time without holding every line in memory.
+*/
+func scanLines(scanner *bufio.Scanner, getTime TimeHandler, progress Progress, bufferContent bool) (linesSort, error) {
+	var lines linesSort
+
+	offset := int64(0)
+
+	for {
+		if ok := scanner.Scan(); !ok {
+			if err := scanner.Err(); err != nil {
+				return nil, errors.Wrap(err, "scanner err")
+			}
+
+			// EOF
+			break
+		}
+
+		line := scanner.Bytes()
+		progress.BytesRead(int64(len(line)) + 1)
+
+		tm, action, err := getTime(line)
+		if action == SKIP {
+			progress.LinesSkipped(1)
+			offset += int64(len(line))
+			continue
+		} else if action == STOP {
+			return nil, err
+		}
+
+		progress.LinesScanned(1)
+
+		l := &lineUnit{timestamp: tm}
+
+		if bufferContent {
+			content := make([]byte, len(line))
+			copy(content, line)
+			l.content = content
+		} else {
+			l.offset = offset
+			l.length = len(line)
+		}
+
+		// +1 for "\n"
+		offset += int64(len(line)) + 1
+		lines = append(lines, l)
+	}
+
+	progress.SortStarted(int64(len(lines)))
+	sort.Sort(lines)
+	progress.SortFinished(int64(len(lines)))
+
+	return lines, nil
+}
+
+/*
+	writeLines is the write half of the core shared by SortByOption's plain
+	path and SortReaderByOption: it writes lines, in order, to writer,
+	reporting progress. A line with no buffered content is fetched through
+	readAt instead (the ReadAt fast path); readAt may be nil when every
+	line is known to carry its own content.
+*/
+func writeLines(lines linesSort, writer *bufio.Writer, progress Progress, readAt func(length int, offset int64) ([]byte, error)) error {
+	for _, l := range lines {
+		var line []byte
+
+		if l.content != nil {
+			line = append(l.content, '\n')
+		} else {
+			var err error
+
+			line, err = readAt(l.length, l.offset)
+			if err != nil {
+				return err
+			}
+		}
+
+		if _, err := writer.Write(line); err != nil {
+			return errors.Wrap(err, "writer write")
+		}
+
+		progress.LinesWritten(1)
+
+		if err := writer.Flush(); err != nil {
+			return errors.Wrap(err, "writer flush")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,329 @@
+package logsort
+
+import (
+	"bufio"
+	"compress/gzip"
+	"container/heap"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+/*
+	sortExternal implements Option.External: it streams SrcFile in
+	ChunkBytes-sized chunks, sorts each chunk in RAM and spills it to a
+	gzip-compressed temp file, then k-way merges the spills into DstFile
+	using a container/heap min-heap keyed by timestamp.
+*/
+func sortExternal(option Option, progress Progress) error {
+	srcFd, err := os.Open(option.SrcFile)
+	if err != nil {
+		return err
+	}
+
+	defer srcFd.Close()
+
+	srcCodec, err := resolveSrcCodec(option.SrcFile, option.srcCodecName(), srcFd)
+	if err != nil {
+		return err
+	}
+
+	var scanner *bufio.Scanner
+	if srcCodec != nil {
+		rc, err := srcCodec.NewReader(srcFd)
+		if err != nil {
+			return errors.Wrap(err, "new reader")
+		}
+
+		defer rc.Close()
+
+		scanner = bufio.NewScanner(rc)
+	} else {
+		scanner = bufio.NewScanner(srcFd)
+	}
+
+	tempDir, err := ioutil.TempDir(option.TempDir, "logsort-external-")
+	if err != nil {
+		return errors.Wrap(err, "create temp dir")
+	}
+
+	defer os.RemoveAll(tempDir)
+
+	chunkBytes := option.ChunkBytes
+	if chunkBytes <= 0 {
+		chunkBytes = defaultChunkBytes
+	}
+
+	var (
+		spillFiles []string
+		chunk      linesSort
+		chunkSize  int64
+	)
+
+	flushChunk := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+
+		progress.SortStarted(int64(len(chunk)))
+		sort.Sort(chunk)
+		progress.SortFinished(int64(len(chunk)))
+
+		path, err := spillChunk(tempDir, chunk)
+		if err != nil {
+			return err
+		}
+
+		spillFiles = append(spillFiles, path)
+		chunk = nil
+		chunkSize = 0
+
+		return nil
+	}
+
+	for {
+		if ok := scanner.Scan(); !ok {
+			if err = scanner.Err(); err != nil {
+				return errors.Wrap(err, "scanner err")
+			}
+
+			// EOF
+			break
+		}
+
+		line := scanner.Bytes()
+		progress.BytesRead(int64(len(line)) + 1)
+
+		tm, action, err := option.GetTime(line)
+		if action == SKIP {
+			progress.LinesSkipped(1)
+			continue
+		} else if action == STOP {
+			return err
+		}
+
+		progress.LinesScanned(1)
+
+		content := make([]byte, len(line))
+		copy(content, line)
+
+		chunk = append(chunk, &lineUnit{timestamp: tm, content: content})
+		chunkSize += int64(len(content))
+
+		if chunkSize >= chunkBytes {
+			if err = flushChunk(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = flushChunk(); err != nil {
+		return err
+	}
+
+	return mergeSpills(spillFiles, option.DstFile, option.dstCodecName(), option.GetTime, progress)
+}
+
+// spillChunk writes a sorted chunk to a new gzip-compressed temp file under
+// dir and returns its path.
+func spillChunk(dir string, chunk linesSort) (string, error) {
+	fd, err := ioutil.TempFile(dir, "chunk-")
+	if err != nil {
+		return "", errors.Wrap(err, "create spill file")
+	}
+
+	defer fd.Close()
+
+	gzFd := gzip.NewWriter(fd)
+	writer := bufio.NewWriter(gzFd)
+
+	for _, l := range chunk {
+		if _, err := writer.Write(l.content); err != nil {
+			return "", errors.Wrapf(err, "spill %s write", fd.Name())
+		}
+
+		if err := writer.WriteByte('\n'); err != nil {
+			return "", errors.Wrapf(err, "spill %s write", fd.Name())
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return "", errors.Wrapf(err, "spill %s flush", fd.Name())
+	}
+
+	if err := gzFd.Close(); err != nil {
+		return "", errors.Wrapf(err, "spill %s close", fd.Name())
+	}
+
+	return fd.Name(), nil
+}
+
+// spillSource tracks the current candidate line read back from one spill
+// file, for the k-way merge heap.
+type spillSource struct {
+	fd        *os.File
+	gzFd      *gzip.Reader
+	scanner   *bufio.Scanner
+	timestamp int64
+	line      []byte
+}
+
+// advance scans the next usable line out of the spill, applying getTime to
+// recover its timestamp. It returns false once the spill is exhausted.
+func (s *spillSource) advance(getTime TimeHandler) (bool, error) {
+	for s.scanner.Scan() {
+		line := s.scanner.Bytes()
+
+		tm, action, err := getTime(line)
+		if action == SKIP {
+			continue
+		} else if action == STOP {
+			return false, err
+		}
+
+		s.timestamp = tm
+		s.line = append(s.line[:0], line...)
+
+		return true, nil
+	}
+
+	return false, s.scanner.Err()
+}
+
+func (s *spillSource) close() error {
+	if err := s.gzFd.Close(); err != nil {
+		s.fd.Close()
+		return err
+	}
+
+	return s.fd.Close()
+}
+
+// spillHeap is a container/heap min-heap of spillSources, ordered by the
+// timestamp of each source's current candidate line.
+type spillHeap []*spillSource
+
+func (h spillHeap) Len() int { return len(h) }
+
+func (h spillHeap) Less(i, j int) bool { return h[i].timestamp < h[j].timestamp }
+
+func (h spillHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *spillHeap) Push(x interface{}) { *h = append(*h, x.(*spillSource)) }
+
+func (h *spillHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+
+	return item
+}
+
+// closeSpillHeap closes every source still in h, for a caller bailing out of
+// the k-way merge early (e.g. on a write error) that would otherwise leak
+// the remaining spills' file handles.
+func closeSpillHeap(h spillHeap) {
+	for _, src := range h {
+		src.close()
+	}
+}
+
+// mergeSpills performs the k-way merge of the sorted spill files into
+// dstFile, cleaning up each spill's handles as it is exhausted.
+func mergeSpills(spillFiles []string, dstFile string, dstCodecName string, getTime TimeHandler, progress Progress) error {
+	dstFd, err := os.Create(dstFile)
+	if err != nil {
+		return err
+	}
+
+	defer dstFd.Close()
+
+	dstCodec, err := resolveDstCodec(dstFile, dstCodecName)
+	if err != nil {
+		return err
+	}
+
+	var writer *bufio.Writer
+	if dstCodec != nil {
+		wc := dstCodec.NewWriter(dstFd)
+
+		defer wc.Close()
+
+		writer = bufio.NewWriter(wc)
+	} else {
+		writer = bufio.NewWriter(dstFd)
+	}
+
+	h := make(spillHeap, 0, len(spillFiles))
+
+	for _, path := range spillFiles {
+		fd, err := os.Open(path)
+		if err != nil {
+			return errors.Wrapf(err, "open spill %s", path)
+		}
+
+		gzFd, err := gzip.NewReader(fd)
+		if err != nil {
+			fd.Close()
+			return errors.Wrapf(err, "new reader spill %s", path)
+		}
+
+		src := &spillSource{fd: fd, gzFd: gzFd, scanner: bufio.NewScanner(gzFd)}
+
+		ok, err := src.advance(getTime)
+		if err != nil {
+			src.close()
+			return errors.Wrapf(err, "read spill %s", path)
+		}
+
+		if !ok {
+			src.close()
+			continue
+		}
+
+		h = append(h, src)
+	}
+
+	heap.Init(&h)
+
+	for h.Len() > 0 {
+		src := heap.Pop(&h).(*spillSource)
+
+		if _, err := writer.Write(src.line); err != nil {
+			src.close()
+			closeSpillHeap(h)
+
+			return errors.Wrapf(err, "writer %s write", dstFile)
+		}
+
+		if err := writer.WriteByte('\n'); err != nil {
+			src.close()
+			closeSpillHeap(h)
+
+			return errors.Wrapf(err, "writer %s write", dstFile)
+		}
+
+		progress.LinesWritten(1)
+
+		ok, err := src.advance(getTime)
+		if err != nil {
+			src.close()
+			return errors.Wrapf(err, "read spill")
+		}
+
+		if !ok {
+			if err := src.close(); err != nil {
+				return errors.Wrap(err, "close spill")
+			}
+
+			continue
+		}
+
+		heap.Push(&h, src)
+	}
+
+	return writer.Flush()
+}
@@ -0,0 +1,85 @@
+package logsort
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestSortExternal(t *testing.T) {
+	dir := t.TempDir()
+	srcFile := filepath.Join(dir, "src.log")
+	dstFile := filepath.Join(dir, "dst.log")
+
+	lines := []string{
+		"2020/01/18 12:24:38 c",
+		"2020/01/18 12:20:30 a",
+		"2020/01/18 12:31:05 d",
+		"2020/01/18 12:21:55 b",
+	}
+
+	var content string
+	for _, line := range lines {
+		content += line + "\n"
+	}
+
+	if err := ioutil.WriteFile(srcFile, []byte(content), 0644); err != nil {
+		t.Fatalf("write src file: %s", err)
+	}
+
+	option := Option{
+		SrcFile:    srcFile,
+		DstFile:    dstFile,
+		GetTime:    timeStartHandler("2006/01/02 15:04:05"),
+		External:   true,
+		ChunkBytes: 1, // force every line into its own spill chunk
+		TempDir:    dir,
+	}
+
+	if err := SortByOption(option); err != nil {
+		t.Fatalf("SortByOption: %s", err)
+	}
+
+	got, err := ioutil.ReadFile(dstFile)
+	if err != nil {
+		t.Fatalf("read dst file: %s", err)
+	}
+
+	want := "2020/01/18 12:20:30 a\n2020/01/18 12:21:55 b\n2020/01/18 12:24:38 c\n2020/01/18 12:31:05 d\n"
+	if string(got) != want {
+		t.Errorf("different content, sort failed\ngot:  %q\nwant: %q", string(got), want)
+	}
+}
+
+func TestSortExternalSkipsUnparsableLines(t *testing.T) {
+	dir := t.TempDir()
+	srcFile := filepath.Join(dir, "src.log")
+	dstFile := filepath.Join(dir, "dst.log")
+
+	content := "not a timestamp\n2020/01/18 12:20:30 a\n"
+	if err := ioutil.WriteFile(srcFile, []byte(content), 0644); err != nil {
+		t.Fatalf("write src file: %s", err)
+	}
+
+	option := Option{
+		SrcFile:  srcFile,
+		DstFile:  dstFile,
+		GetTime:  timeStartHandler("2006/01/02 15:04:05"),
+		External: true,
+		TempDir:  dir,
+	}
+
+	if err := SortByOption(option); err != nil {
+		t.Fatalf("SortByOption: %s", err)
+	}
+
+	got, err := ioutil.ReadFile(dstFile)
+	if err != nil {
+		t.Fatalf("read dst file: %s", err)
+	}
+
+	want := "2020/01/18 12:20:30 a\n"
+	if string(got) != want {
+		t.Errorf("different content, sort failed\ngot:  %q\nwant: %q", string(got), want)
+	}
+}
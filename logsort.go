@@ -20,9 +20,7 @@ package logsort
 
 import (
 	"bufio"
-	"compress/gzip"
 	"os"
-	"sort"
 
 	"github.com/pkg/errors"
 )
@@ -49,6 +47,8 @@ var (
 	ErrNeedTimeHandler = errors.New("logsort: need time handler")
 	// ErrSameSRCAndDST returned when the srcfile is same as dstfile.
 	ErrSameSRCAndDST = errors.New("logsort: same src file and dst file")
+	// ErrNeedSrcFiles returned when MergeOption.SrcFiles is empty.
+	ErrNeedSrcFiles = errors.New("logsort: need src files")
 )
 
 type lineUnit struct {
@@ -64,9 +64,68 @@ type lineUnit struct {
 type Option struct {
 	SrcFile string      // Need sort file path
 	DstFile string      // The output file path
-	SrcGzip bool        // if srcGzip, logsort will read whole file into RAM
-	DstGzip bool        // Output file in gzip format
 	GetTime TimeHandler // The function to getTime from each line
+
+	// SrcGzip: Deprecated, use SrcCodec: "gzip" instead.
+	SrcGzip bool
+	// DstGzip: Deprecated, use DstCodec: "gzip" instead.
+	DstGzip bool
+
+	// SrcCodec names the Codec (see RegisterCodec) used to decompress
+	// SrcFile, or "" for none. AutoDetect picks one from the file
+	// extension, falling back to sniffing the file's magic bytes.
+	SrcCodec string
+	// DstCodec names the Codec used to compress DstFile, or "" for none.
+	// AutoDetect picks one from DstFile's extension.
+	DstCodec string
+
+	// External enables an on-disk merge sort, for inputs that don't fit in
+	// RAM (or gzip sources, which otherwise must be read whole). Instead of
+	// keeping every line in memory, the input is split into bounded chunks,
+	// each chunk is sorted and spilled to a temp file, then the spills are
+	// merged with a container/heap min-heap keyed by timestamp.
+	External bool
+	// ChunkBytes caps the in-memory size of a chunk before it is spilled.
+	// Defaults to defaultChunkBytes when zero.
+	ChunkBytes int64
+	// TempDir is where spill files are written. Defaults to os.TempDir()
+	// when empty.
+	TempDir string
+
+	// Progress, when set, receives observability events as the sort runs.
+	// A nil Progress is a no-op.
+	Progress Progress
+}
+
+// defaultChunkBytes is the ChunkBytes used when Option.ChunkBytes is unset.
+const defaultChunkBytes = 64 << 20
+
+// srcCodecName resolves SrcCodec, falling back to the deprecated SrcGzip
+// shim.
+func (option Option) srcCodecName() string {
+	if option.SrcCodec != "" {
+		return option.SrcCodec
+	}
+
+	if option.SrcGzip {
+		return "gzip"
+	}
+
+	return ""
+}
+
+// dstCodecName resolves DstCodec, falling back to the deprecated DstGzip
+// shim.
+func (option Option) dstCodecName() string {
+	if option.DstCodec != "" {
+		return option.DstCodec
+	}
+
+	if option.DstGzip {
+		return "gzip"
+	}
+
+	return ""
 }
 
 type linesSort []*lineUnit
@@ -93,7 +152,14 @@ func Sort(srcFile, dstFile string, getTime TimeHandler) error {
 
 /*
 	Use option to control sort behaviour.
-	Be careful of using srcGzip, because logsort will read whole file into RAM.
+	Be careful of using a SrcCodec (or the deprecated SrcGzip), because
+	logsort will read whole file into RAM, unless option.External is set,
+	which sorts via bounded-memory on-disk chunks.
+
+	SortByOption's plain (uncompressed, non-External) path and
+	SortReaderByOption are both thin wrappers around the same scanLines/
+	writeLines core; the file path passes srcFd.ReadAt to writeLines so it
+	can avoid holding line content in memory, which a Reader can't do.
 */
 func SortByOption(option Option) error {
 	if option.GetTime == nil {
@@ -104,8 +170,25 @@ func SortByOption(option Option) error {
 		return ErrSameSRCAndDST
 	}
 
-	var lines linesSort
+	progress := progressOf(option.Progress)
+
+	var err error
+	if option.External {
+		err = sortExternal(option, progress)
+	} else {
+		err = sortPlain(option, progress)
+	}
+
+	progress.Done(err)
+
+	return err
+}
 
+// sortPlain is SortByOption's non-External path: a thin wrapper around
+// scanLines/writeLines that resolves codecs and, for an uncompressed
+// source, passes srcFd.ReadAt through so line content never has to be
+// held in memory.
+func sortPlain(option Option, progress Progress) error {
 	srcFd, err := os.Open(option.SrcFile)
 	if err != nil {
 		return err
@@ -113,58 +196,30 @@ func SortByOption(option Option) error {
 
 	defer srcFd.Close()
 
+	srcCodec, err := resolveSrcCodec(option.SrcFile, option.srcCodecName(), srcFd)
+	if err != nil {
+		return err
+	}
+
 	var scanner *bufio.Scanner
-	if option.SrcGzip {
-		gzFd, err := gzip.NewReader(srcFd)
+	if srcCodec != nil {
+		rc, err := srcCodec.NewReader(srcFd)
 		if err != nil {
 			return errors.Wrap(err, "new reader")
 		}
 
-		defer gzFd.Close()
+		defer rc.Close()
 
-		scanner = bufio.NewScanner(gzFd)
+		scanner = bufio.NewScanner(rc)
 	} else {
 		scanner = bufio.NewScanner(srcFd)
 	}
 
-	offset := int64(0)
-	for {
-		if ok := scanner.Scan(); !ok {
-			if err = scanner.Err(); err != nil {
-				return errors.Wrap(err, "scanner err")
-			}
-
-			// EOF
-			break
-		}
-
-		line := scanner.Bytes()
-		tm, action, err := option.GetTime(line)
-		if action == SKIP {
-			offset += int64(len(line))
-			continue
-		} else if action == STOP {
-			return err
-		}
-
-		l := &lineUnit{
-			offset:    offset,
-			length:    len(line),
-			timestamp: tm,
-		}
-
-		if option.SrcGzip {
-			temp := string(line)
-			l.content = []byte(temp)
-		}
-
-		// +1 for "\n"
-		offset += int64(len(line)) + 1
-		lines = append(lines, l)
+	lines, err := scanLines(scanner, option.GetTime, progress, srcCodec != nil)
+	if err != nil {
+		return err
 	}
 
-	sort.Sort(lines)
-
 	dstFd, err := os.Create(option.DstFile)
 	if err != nil {
 		return err
@@ -172,37 +227,28 @@ func SortByOption(option Option) error {
 
 	defer dstFd.Close()
 
+	dstCodec, err := resolveDstCodec(option.DstFile, option.dstCodecName())
+	if err != nil {
+		return err
+	}
+
 	var writer *bufio.Writer
-	if option.DstGzip {
-		gzFd := gzip.NewWriter(dstFd)
+	if dstCodec != nil {
+		wc := dstCodec.NewWriter(dstFd)
 
-		defer gzFd.Close()
+		defer wc.Close()
 
-		writer = bufio.NewWriter(gzFd)
+		writer = bufio.NewWriter(wc)
 	} else {
 		writer = bufio.NewWriter(dstFd)
 	}
 
-	for _, l := range lines {
-		var line []byte
-
-		if l.content != nil {
-			line = append(l.content, '\n')
-		} else {
-			line = make([]byte, l.length+1)
-			if _, err := srcFd.ReadAt(line, l.offset); err != nil {
-				return errors.Wrapf(err, "fd %s read offset %d", option.SrcFile, l.offset)
-			}
-		}
-
-		if _, err := writer.Write(line); err != nil {
-			return errors.Wrapf(err, "writer %s write", option.SrcFile)
+	return writeLines(lines, writer, progress, func(length int, offset int64) ([]byte, error) {
+		line := make([]byte, length+1)
+		if _, err := srcFd.ReadAt(line, offset); err != nil {
+			return nil, errors.Wrapf(err, "fd %s read offset %d", option.SrcFile, offset)
 		}
 
-		if err = writer.Flush(); err != nil {
-			return errors.Wrapf(err, "writer %s flush", option.SrcFile)
-		}
-	}
-
-	return nil
+		return line, nil
+	})
 }
@@ -0,0 +1,306 @@
+package logsort
+
+import (
+	"bufio"
+	"container/heap"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+/*
+	MergeOption defined some option can set for merging.
+*/
+type MergeOption struct {
+	SrcFiles []string    // Source files, assumed already time-ordered (e.g. rotated logs)
+	DstFile  string      // The output file path
+	GetTime  TimeHandler // The function to getTime from each line
+	Start    int64       // Only keep lines with timestamp >= Start, if non-zero
+	End      int64       // Only keep lines with timestamp <= End, if non-zero
+
+	// SrcGzip: Deprecated, use SrcCodec: []string{"gzip", ...} instead.
+	SrcGzip []bool
+	// DstGzip: Deprecated, use DstCodec: "gzip" instead.
+	DstGzip bool
+
+	// SrcCodec names, per file in SrcFiles, the Codec used to decompress
+	// it, or "" for none. If nil, every file defaults to AutoDetect.
+	SrcCodec []string
+	// DstCodec names the Codec used to compress DstFile, or "" for none.
+	DstCodec string
+}
+
+// srcCodecName resolves the codec name for SrcFiles[i], falling back to the
+// deprecated SrcGzip shim and then to AutoDetect.
+func (option MergeOption) srcCodecName(i int) string {
+	if option.SrcCodec != nil && i < len(option.SrcCodec) {
+		return option.SrcCodec[i]
+	}
+
+	if option.SrcGzip != nil && i < len(option.SrcGzip) {
+		if option.SrcGzip[i] {
+			return "gzip"
+		}
+
+		return ""
+	}
+
+	return AutoDetect
+}
+
+// dstCodecName resolves DstCodec, falling back to the deprecated DstGzip
+// shim.
+func (option MergeOption) dstCodecName() string {
+	if option.DstCodec != "" {
+		return option.DstCodec
+	}
+
+	if option.DstGzip {
+		return "gzip"
+	}
+
+	return ""
+}
+
+/*
+	Merge src files into dst file, keeping them in timestamp order.
+	Use getTime function to get timestamp. Each src file is assumed to
+	already be time-ordered, such as a set of rotated log files.
+*/
+func Merge(srcFiles []string, dstFile string, getTime TimeHandler) error {
+	option := MergeOption{
+		SrcFiles: srcFiles,
+		DstFile:  dstFile,
+		GetTime:  getTime,
+	}
+
+	return MergeByOption(option)
+}
+
+/*
+	Use option to control merge behaviour. Unlike SortByOption, the sources
+	are streamed with a k-way heap merge instead of being loaded into
+	memory, so MergeByOption is suitable for combining files far larger
+	than RAM, such as "access.log", "access.log.1.gz", "access.log.2.gz".
+*/
+func MergeByOption(option MergeOption) error {
+	if option.GetTime == nil {
+		return ErrNeedTimeHandler
+	}
+
+	if len(option.SrcFiles) == 0 {
+		return ErrNeedSrcFiles
+	}
+
+	for _, src := range option.SrcFiles {
+		if sameFile(src, option.DstFile) {
+			return ErrSameSRCAndDST
+		}
+	}
+
+	sources := make([]*mergeSource, 0, len(option.SrcFiles))
+
+	defer func() {
+		for _, src := range sources {
+			src.close()
+		}
+	}()
+
+	for i, path := range option.SrcFiles {
+		src, err := newMergeSource(path, option.srcCodecName(i))
+		if err != nil {
+			return err
+		}
+
+		sources = append(sources, src)
+	}
+
+	dstFd, err := os.Create(option.DstFile)
+	if err != nil {
+		return err
+	}
+
+	defer dstFd.Close()
+
+	dstCodec, err := resolveDstCodec(option.DstFile, option.dstCodecName())
+	if err != nil {
+		return err
+	}
+
+	var writer *bufio.Writer
+	if dstCodec != nil {
+		wc := dstCodec.NewWriter(dstFd)
+
+		defer wc.Close()
+
+		writer = bufio.NewWriter(wc)
+	} else {
+		writer = bufio.NewWriter(dstFd)
+	}
+
+	h := make(mergeHeap, 0, len(sources))
+
+	for _, src := range sources {
+		ok, err := src.advance(option.GetTime, option.Start, option.End)
+		if err != nil {
+			return errors.Wrapf(err, "read %s", src.path)
+		}
+
+		if ok {
+			h = append(h, src)
+		}
+	}
+
+	heap.Init(&h)
+
+	for h.Len() > 0 {
+		src := heap.Pop(&h).(*mergeSource)
+
+		if _, err := writer.Write(src.line); err != nil {
+			return errors.Wrapf(err, "writer %s write", option.DstFile)
+		}
+
+		if err := writer.WriteByte('\n'); err != nil {
+			return errors.Wrapf(err, "writer %s write", option.DstFile)
+		}
+
+		ok, err := src.advance(option.GetTime, option.Start, option.End)
+		if err != nil {
+			return errors.Wrapf(err, "read %s", src.path)
+		}
+
+		if ok {
+			heap.Push(&h, src)
+		}
+	}
+
+	return writer.Flush()
+}
+
+// sameFile reports whether a and b name the same file. An exact path match
+// is checked first, so a DstFile that doesn't exist yet (the common case)
+// doesn't need to stat successfully; otherwise both are stat'd and compared
+// with os.SameFile, to also catch relative/absolute or symlinked paths that
+// resolve to the same file.
+func sameFile(a, b string) bool {
+	if a == b {
+		return true
+	}
+
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(infoA, infoB)
+}
+
+// mergeSource tracks the current candidate line read from one src file, for
+// the k-way merge heap in MergeByOption.
+type mergeSource struct {
+	path      string
+	fd        *os.File
+	rc        io.ReadCloser
+	scanner   *bufio.Scanner
+	timestamp int64
+	line      []byte
+}
+
+func newMergeSource(path string, codecName string) (*mergeSource, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	src := &mergeSource{path: path, fd: fd}
+
+	codec, err := resolveSrcCodec(path, codecName, fd)
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+
+	if codec != nil {
+		rc, err := codec.NewReader(fd)
+		if err != nil {
+			fd.Close()
+			return nil, errors.Wrapf(err, "new reader %s", path)
+		}
+
+		src.rc = rc
+		src.scanner = bufio.NewScanner(rc)
+	} else {
+		src.scanner = bufio.NewScanner(fd)
+	}
+
+	return src, nil
+}
+
+// advance scans the next line within [start, end], skipping lines before
+// start. It returns false once the file is exhausted or once a line past
+// end is seen, since every source is assumed to already be time-ordered.
+func (s *mergeSource) advance(getTime TimeHandler, start, end int64) (bool, error) {
+	for s.scanner.Scan() {
+		line := s.scanner.Bytes()
+
+		tm, action, err := getTime(line)
+		if action == SKIP {
+			continue
+		} else if action == STOP {
+			return false, err
+		}
+
+		if start != 0 && tm < start {
+			continue
+		}
+
+		if end != 0 && tm > end {
+			return false, nil
+		}
+
+		s.timestamp = tm
+		s.line = append(s.line[:0], line...)
+
+		return true, nil
+	}
+
+	return false, s.scanner.Err()
+}
+
+func (s *mergeSource) close() error {
+	if s.rc != nil {
+		if err := s.rc.Close(); err != nil {
+			s.fd.Close()
+			return err
+		}
+	}
+
+	return s.fd.Close()
+}
+
+// mergeHeap is a container/heap min-heap of mergeSources, ordered by the
+// timestamp of each source's current candidate line.
+type mergeHeap []*mergeSource
+
+func (h mergeHeap) Len() int { return len(h) }
+
+func (h mergeHeap) Less(i, j int) bool { return h[i].timestamp < h[j].timestamp }
+
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(*mergeSource)) }
+
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+
+	return item
+}
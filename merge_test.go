@@ -0,0 +1,182 @@
+package logsort
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+
+	file1 := filepath.Join(dir, "access.log.1")
+	file2 := filepath.Join(dir, "access.log.2")
+	dstFile := filepath.Join(dir, "dst.log")
+
+	if err := ioutil.WriteFile(file1, []byte(
+		"2020/01/18 12:20:30 a\n2020/01/18 12:24:38 c\n"), 0644); err != nil {
+		t.Fatalf("write file1: %s", err)
+	}
+
+	if err := ioutil.WriteFile(file2, []byte(
+		"2020/01/18 12:21:55 b\n2020/01/18 12:31:05 d\n"), 0644); err != nil {
+		t.Fatalf("write file2: %s", err)
+	}
+
+	getTime := timeStartHandler("2006/01/02 15:04:05")
+
+	if err := Merge([]string{file1, file2}, dstFile, getTime); err != nil {
+		t.Fatalf("Merge: %s", err)
+	}
+
+	got, err := ioutil.ReadFile(dstFile)
+	if err != nil {
+		t.Fatalf("read dst file: %s", err)
+	}
+
+	want := "2020/01/18 12:20:30 a\n2020/01/18 12:21:55 b\n2020/01/18 12:24:38 c\n2020/01/18 12:31:05 d\n"
+	if string(got) != want {
+		t.Errorf("different content, merge failed\ngot:  %q\nwant: %q", string(got), want)
+	}
+}
+
+func TestMergeByOptionTimeRange(t *testing.T) {
+	dir := t.TempDir()
+
+	file1 := filepath.Join(dir, "access.log.1")
+	dstFile := filepath.Join(dir, "dst.log")
+
+	if err := ioutil.WriteFile(file1, []byte(
+		"2020/01/18 12:20:30 a\n2020/01/18 12:24:38 b\n2020/01/18 12:31:05 c\n"), 0644); err != nil {
+		t.Fatalf("write file1: %s", err)
+	}
+
+	getTime := timeStartHandler("2006/01/02 15:04:05")
+
+	start, _, err := getTime([]byte("2020/01/18 12:21:00"))
+	if err != nil {
+		t.Fatalf("getTime start: %s", err)
+	}
+
+	end, _, err := getTime([]byte("2020/01/18 12:30:00"))
+	if err != nil {
+		t.Fatalf("getTime end: %s", err)
+	}
+
+	option := MergeOption{
+		SrcFiles: []string{file1},
+		DstFile:  dstFile,
+		GetTime:  getTime,
+		Start:    start,
+		End:      end,
+	}
+
+	if err := MergeByOption(option); err != nil {
+		t.Fatalf("MergeByOption: %s", err)
+	}
+
+	got, err := ioutil.ReadFile(dstFile)
+	if err != nil {
+		t.Fatalf("read dst file: %s", err)
+	}
+
+	want := "2020/01/18 12:24:38 b\n"
+	if string(got) != want {
+		t.Errorf("different content, merge failed\ngot:  %q\nwant: %q", string(got), want)
+	}
+}
+
+func TestMergeByOptionNeedSrcFiles(t *testing.T) {
+	option := MergeOption{
+		DstFile: filepath.Join(t.TempDir(), "dst.log"),
+		GetTime: timeStartHandler("2006/01/02 15:04:05"),
+	}
+
+	if err := MergeByOption(option); err != ErrNeedSrcFiles {
+		t.Errorf("expected ErrNeedSrcFiles, got %v", err)
+	}
+}
+
+func TestMergeByOptionSameSrcAndDst(t *testing.T) {
+	dir := t.TempDir()
+
+	file1 := filepath.Join(dir, "access.log")
+	file2 := filepath.Join(dir, "access.log.1")
+
+	if err := ioutil.WriteFile(file1, []byte("2020/01/18 12:20:30 a\n"), 0644); err != nil {
+		t.Fatalf("write file1: %s", err)
+	}
+
+	if err := ioutil.WriteFile(file2, []byte("2020/01/18 12:21:55 b\n"), 0644); err != nil {
+		t.Fatalf("write file2: %s", err)
+	}
+
+	option := MergeOption{
+		SrcFiles: []string{file1, file2},
+		DstFile:  file1,
+		GetTime:  timeStartHandler("2006/01/02 15:04:05"),
+	}
+
+	if err := MergeByOption(option); err != ErrSameSRCAndDST {
+		t.Errorf("expected ErrSameSRCAndDST, got %v", err)
+	}
+}
+
+// TestMergeMixedGzipAndPlain covers the request's headline scenario:
+// merging a plain rotated log with a .gz rotated log, exercising the
+// per-file srcCodecName/AutoDetect path rather than a plain-text-only
+// merge.
+func TestMergeMixedGzipAndPlain(t *testing.T) {
+	dir := t.TempDir()
+
+	file1 := filepath.Join(dir, "access.log")
+	file2 := filepath.Join(dir, "access.log.1.gz")
+	dstFile := filepath.Join(dir, "dst.log")
+
+	if err := ioutil.WriteFile(file1, []byte(
+		"2020/01/18 12:24:38 c\n2020/01/18 12:31:05 d\n"), 0644); err != nil {
+		t.Fatalf("write file1: %s", err)
+	}
+
+	gzFd, err := os.Create(file2)
+	if err != nil {
+		t.Fatalf("create file2: %s", err)
+	}
+
+	gw := gzip.NewWriter(gzFd)
+	if _, err := gw.Write([]byte("2020/01/18 12:20:30 a\n2020/01/18 12:21:55 b\n")); err != nil {
+		t.Fatalf("gzip write: %s", err)
+	}
+
+	if err := gw.Close(); err != nil {
+		t.Fatalf("gzip close: %s", err)
+	}
+
+	if err := gzFd.Close(); err != nil {
+		t.Fatalf("close file2: %s", err)
+	}
+
+	getTime := timeStartHandler("2006/01/02 15:04:05")
+
+	option := MergeOption{
+		SrcFiles: []string{file2, file1},
+		DstFile:  dstFile,
+		GetTime:  getTime,
+	}
+
+	if err := MergeByOption(option); err != nil {
+		t.Fatalf("MergeByOption: %s", err)
+	}
+
+	got, err := ioutil.ReadFile(dstFile)
+	if err != nil {
+		t.Fatalf("read dst file: %s", err)
+	}
+
+	want := "2020/01/18 12:20:30 a\n2020/01/18 12:21:55 b\n2020/01/18 12:24:38 c\n2020/01/18 12:31:05 d\n"
+	if string(got) != want {
+		t.Errorf("different content, merge failed\ngot:  %q\nwant: %q", string(got), want)
+	}
+}
@@ -0,0 +1,204 @@
+package logsort
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+	Progress receives observability events as a sort runs, so a caller
+	sorting a multi-GB log isn't left staring at a blank terminal. All
+	methods are called from the goroutine driving the sort; a nil
+	Option.Progress is treated as a no-op.
+*/
+type Progress interface {
+	// BytesRead is called with the number of raw bytes consumed for each
+	// scanned line (including its trailing newline).
+	BytesRead(n int64)
+	// LinesScanned is called once per line accepted for sorting.
+	LinesScanned(n int64)
+	// LinesSkipped is called once per line the TimeHandler marked SKIP.
+	LinesSkipped(n int64)
+	// SortStarted is called with the number of lines about to be sorted,
+	// right before sort.Sort begins.
+	SortStarted(total int64)
+	// SortFinished is called once, right after sort.Sort returns for the
+	// batch SortStarted announced.
+	SortFinished(total int64)
+	// LinesWritten is called once per line written to the destination.
+	LinesWritten(n int64)
+	// Done is called once, with the sort's final error (nil on success).
+	Done(err error)
+}
+
+type noopProgress struct{}
+
+func (noopProgress) BytesRead(int64)    {}
+func (noopProgress) LinesScanned(int64) {}
+func (noopProgress) LinesSkipped(int64) {}
+func (noopProgress) SortStarted(int64)  {}
+func (noopProgress) SortFinished(int64) {}
+func (noopProgress) LinesWritten(int64) {}
+func (noopProgress) Done(error)         {}
+
+// progressOf returns p, or a no-op Progress if p is nil.
+func progressOf(p Progress) Progress {
+	if p == nil {
+		return noopProgress{}
+	}
+
+	return p
+}
+
+// termProgressInterval rate-limits TermProgress's redraws to about 10Hz.
+const termProgressInterval = 100 * time.Millisecond
+
+/*
+	TermProgress is a Progress that renders a single \r-updated status line
+	to Out (os.Stderr by default), redrawn at about 10Hz regardless of how
+	often its methods are called.
+*/
+type TermProgress struct {
+	Out io.Writer // defaults to os.Stderr when nil
+
+	mu        sync.Mutex
+	scanned   int64
+	skipped   int64
+	bytesRead int64
+	total     int64
+	written   int64
+	lastDraw  time.Time
+}
+
+func (t *TermProgress) out() io.Writer {
+	if t.Out != nil {
+		return t.Out
+	}
+
+	return os.Stderr
+}
+
+func (t *TermProgress) BytesRead(n int64) {
+	t.mu.Lock()
+	t.bytesRead += n
+	t.mu.Unlock()
+
+	t.redrawThrottled()
+}
+
+func (t *TermProgress) LinesScanned(n int64) {
+	t.mu.Lock()
+	t.scanned += n
+	t.mu.Unlock()
+
+	t.redrawThrottled()
+}
+
+func (t *TermProgress) LinesSkipped(n int64) {
+	t.mu.Lock()
+	t.skipped += n
+	t.mu.Unlock()
+}
+
+func (t *TermProgress) SortStarted(total int64) {
+	t.mu.Lock()
+	t.total = total
+	t.mu.Unlock()
+
+	t.redraw()
+}
+
+func (t *TermProgress) SortFinished(total int64) {
+	t.redrawThrottled()
+}
+
+func (t *TermProgress) LinesWritten(n int64) {
+	t.mu.Lock()
+	t.written += n
+	t.mu.Unlock()
+
+	t.redrawThrottled()
+}
+
+func (t *TermProgress) Done(err error) {
+	t.redraw()
+
+	if err != nil {
+		fmt.Fprintf(t.out(), " error: %s\n", err)
+	} else {
+		fmt.Fprintln(t.out())
+	}
+}
+
+func (t *TermProgress) redrawThrottled() {
+	t.mu.Lock()
+	due := time.Since(t.lastDraw) >= termProgressInterval
+	t.mu.Unlock()
+
+	if due {
+		t.redraw()
+	}
+}
+
+func (t *TermProgress) redraw() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lastDraw = time.Now()
+
+	fmt.Fprintf(t.out(), "\rscanned %d lines (%d bytes), skipped %d, written %d/%d",
+		t.scanned, t.bytesRead, t.skipped, t.written, t.total)
+}
+
+/*
+	JSONProgress is a Progress that emits newline-delimited JSON events to
+	Out (os.Stderr by default), one per method call, for callers that want
+	to pipe sort progress into another tool rather than a terminal.
+*/
+type JSONProgress struct {
+	Out io.Writer // defaults to os.Stderr when nil
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+type progressEvent struct {
+	Event string `json:"event"`
+	N     int64  `json:"n,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func (j *JSONProgress) emit(event string, n int64, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.enc == nil {
+		out := j.Out
+		if out == nil {
+			out = os.Stderr
+		}
+
+		j.enc = json.NewEncoder(out)
+	}
+
+	ev := progressEvent{Event: event, N: n}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+
+	// Best-effort: there's nothing actionable to do with an encode error
+	// from inside a progress callback.
+	_ = j.enc.Encode(ev)
+}
+
+func (j *JSONProgress) BytesRead(n int64)        { j.emit("bytes_read", n, nil) }
+func (j *JSONProgress) LinesScanned(n int64)     { j.emit("lines_scanned", n, nil) }
+func (j *JSONProgress) LinesSkipped(n int64)     { j.emit("lines_skipped", n, nil) }
+func (j *JSONProgress) SortStarted(total int64)  { j.emit("sort_started", total, nil) }
+func (j *JSONProgress) SortFinished(total int64) { j.emit("sort_finished", total, nil) }
+func (j *JSONProgress) LinesWritten(n int64)     { j.emit("lines_written", n, nil) }
+func (j *JSONProgress) Done(err error)           { j.emit("done", 0, err) }
@@ -0,0 +1,92 @@
+package logsort
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJSONProgressEventOrder(t *testing.T) {
+	dir := t.TempDir()
+	srcFile := filepath.Join(dir, "src.log")
+	dstFile := filepath.Join(dir, "dst.log")
+
+	if err := ioutil.WriteFile(srcFile, []byte(
+		"2020/01/18 12:24:38 b\nnot a timestamp\n2020/01/18 12:20:30 a\n"), 0644); err != nil {
+		t.Fatalf("write src file: %s", err)
+	}
+
+	var out bytes.Buffer
+
+	option := Option{
+		SrcFile:  srcFile,
+		DstFile:  dstFile,
+		GetTime:  timeStartHandler("2006/01/02 15:04:05"),
+		Progress: &JSONProgress{Out: &out},
+	}
+
+	if err := SortByOption(option); err != nil {
+		t.Fatalf("SortByOption: %s", err)
+	}
+
+	var events []string
+
+	dec := json.NewDecoder(&out)
+	for {
+		var ev progressEvent
+
+		if err := dec.Decode(&ev); err != nil {
+			break
+		}
+
+		events = append(events, ev.Event)
+	}
+
+	want := []string{
+		"bytes_read", "lines_scanned",
+		"bytes_read", "lines_skipped",
+		"bytes_read", "lines_scanned",
+		"sort_started", "sort_finished", "lines_written", "lines_written", "done",
+	}
+
+	if strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Errorf("unexpected event order\ngot:  %v\nwant: %v", events, want)
+	}
+}
+
+func TestJSONProgressDoneCarriesError(t *testing.T) {
+	var out bytes.Buffer
+
+	p := &JSONProgress{Out: &out}
+	p.Done(errors.New("boom"))
+
+	var ev progressEvent
+	if err := json.NewDecoder(&out).Decode(&ev); err != nil {
+		t.Fatalf("decode event: %s", err)
+	}
+
+	if ev.Event != "done" || ev.Error != "boom" {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+}
+
+func TestProgressOfNilIsNoop(t *testing.T) {
+	p := progressOf(nil)
+
+	if _, ok := p.(noopProgress); !ok {
+		t.Errorf("expected noopProgress, got %T", p)
+	}
+
+	// Must not panic.
+	p.BytesRead(1)
+	p.LinesScanned(1)
+	p.LinesSkipped(1)
+	p.SortStarted(1)
+	p.SortFinished(1)
+	p.LinesWritten(1)
+	p.Done(nil)
+}
@@ -0,0 +1,118 @@
+package logsort
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+/*
+	ReaderOption defined some option can set for sorting a Reader into a
+	Writer, for callers that don't have (or don't want to stage data on
+	disk as) a SrcFile/DstFile path, such as an HTTP body, an S3 object, or
+	a pipe.
+*/
+type ReaderOption struct {
+	Src     io.Reader   // Need sort reader
+	Dst     io.Writer   // The output writer
+	GetTime TimeHandler // The function to getTime from each line
+
+	// SrcCodec names the Codec used to decompress Src, or "" for none.
+	// Since a Reader has no file extension, AutoDetect can only fall back
+	// to peeking Src's first bytes.
+	SrcCodec string
+	// DstCodec names the Codec used to compress Dst, or "" for none.
+	// AutoDetect has nothing to go on for a Writer, so it behaves as "".
+	DstCodec string
+
+	// Progress, when set, receives observability events as the sort runs.
+	// A nil Progress is a no-op.
+	Progress Progress
+}
+
+/*
+	SortReader sorts the lines read from src, and writes them in timestamp
+	order to dst. Use getTime function to get timestamp.
+*/
+func SortReader(src io.Reader, dst io.Writer, getTime TimeHandler) error {
+	option := ReaderOption{
+		Src:     src,
+		Dst:     dst,
+		GetTime: getTime,
+	}
+
+	return SortReaderByOption(option)
+}
+
+/*
+	Use option to control SortReader's behaviour.
+
+	SortReaderByOption is a thin wrapper around the same scanLines/
+	writeLines core as SortByOption's plain path. Unlike that path, it
+	can't pass a ReadAt fast path through to writeLines, since a Reader
+	can't be seeked back into, so it always buffers every line's content;
+	for inputs too large to hold in RAM this way, stage them to a file and
+	use Option.External instead.
+*/
+func SortReaderByOption(option ReaderOption) error {
+	if option.GetTime == nil {
+		return ErrNeedTimeHandler
+	}
+
+	progress := progressOf(option.Progress)
+
+	err := sortReader(option, progress)
+
+	progress.Done(err)
+
+	return err
+}
+
+// sortReader is SortReaderByOption's progress-taking implementation, so its
+// caller can run progress.Done(err) after it returns either way.
+func sortReader(option ReaderOption, progress Progress) error {
+	br := bufio.NewReader(option.Src)
+
+	srcCodec, err := resolveStreamSrcCodec(option.SrcCodec, br)
+	if err != nil {
+		return err
+	}
+
+	var scanner *bufio.Scanner
+	if srcCodec != nil {
+		rc, err := srcCodec.NewReader(br)
+		if err != nil {
+			return errors.Wrap(err, "new reader")
+		}
+
+		defer rc.Close()
+
+		scanner = bufio.NewScanner(rc)
+	} else {
+		scanner = bufio.NewScanner(br)
+	}
+
+	lines, err := scanLines(scanner, option.GetTime, progress, true)
+	if err != nil {
+		return err
+	}
+
+	dstCodec, err := resolveDstCodec("", option.DstCodec)
+	if err != nil {
+		return err
+	}
+
+	var writer *bufio.Writer
+	if dstCodec != nil {
+		wc := dstCodec.NewWriter(option.Dst)
+
+		defer wc.Close()
+
+		writer = bufio.NewWriter(wc)
+	} else {
+		writer = bufio.NewWriter(option.Dst)
+	}
+
+	return writeLines(lines, writer, progress, nil)
+}
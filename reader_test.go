@@ -0,0 +1,88 @@
+package logsort
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+func TestSortReader(t *testing.T) {
+	src := bytes.NewBufferString(
+		"2020/01/18 12:24:38 c\n2020/01/18 12:20:30 a\n2020/01/18 12:21:55 b\n")
+
+	var dst bytes.Buffer
+
+	getTime := timeStartHandler("2006/01/02 15:04:05")
+
+	if err := SortReader(src, &dst, getTime); err != nil {
+		t.Fatalf("SortReader: %s", err)
+	}
+
+	want := "2020/01/18 12:20:30 a\n2020/01/18 12:21:55 b\n2020/01/18 12:24:38 c\n"
+	if dst.String() != want {
+		t.Errorf("different content, sort failed\ngot:  %q\nwant: %q", dst.String(), want)
+	}
+}
+
+func TestSortReaderByOptionNeedTimeHandler(t *testing.T) {
+	option := ReaderOption{
+		Src: bytes.NewBufferString(""),
+		Dst: &bytes.Buffer{},
+	}
+
+	if err := SortReaderByOption(option); err != ErrNeedTimeHandler {
+		t.Errorf("expected ErrNeedTimeHandler, got %v", err)
+	}
+}
+
+func TestSortReaderByOptionAutoDetectSrcCodec(t *testing.T) {
+	src := bytes.NewBuffer(nil)
+
+	gw := gzip.NewWriter(src)
+	if _, err := gw.Write([]byte("2020/01/18 12:20:30 a\n")); err != nil {
+		t.Fatalf("gzip write: %s", err)
+	}
+
+	if err := gw.Close(); err != nil {
+		t.Fatalf("gzip close: %s", err)
+	}
+
+	var dst bytes.Buffer
+
+	option := ReaderOption{
+		Src:      src,
+		Dst:      &dst,
+		GetTime:  timeStartHandler("2006/01/02 15:04:05"),
+		SrcCodec: AutoDetect,
+	}
+
+	if err := SortReaderByOption(option); err != nil {
+		t.Fatalf("SortReaderByOption: %s", err)
+	}
+
+	want := "2020/01/18 12:20:30 a\n"
+	if dst.String() != want {
+		t.Errorf("different content, sort failed\ngot:  %q\nwant: %q", dst.String(), want)
+	}
+}
+
+func TestSortReaderByOptionReportsProgress(t *testing.T) {
+	src := bytes.NewBufferString("2020/01/18 12:20:30 a\n2020/01/18 12:21:55 b\n")
+
+	var dst, progressOut bytes.Buffer
+
+	option := ReaderOption{
+		Src:      src,
+		Dst:      &dst,
+		GetTime:  timeStartHandler("2006/01/02 15:04:05"),
+		Progress: &JSONProgress{Out: &progressOut},
+	}
+
+	if err := SortReaderByOption(option); err != nil {
+		t.Fatalf("SortReaderByOption: %s", err)
+	}
+
+	if progressOut.Len() == 0 {
+		t.Errorf("expected Progress to receive events, got none")
+	}
+}
@@ -0,0 +1,323 @@
+/*
+Package watch turns logsort into a daemon-friendly component for
+logrotate-style pipelines: it watches a directory, and whenever a rotated
+file matching a glob appears and stops growing, it sorts it with
+logsort.SortByOption and writes the result next to the original.
+
+Example:
+
+    w := watch.Watcher{
+        Dir:     "/var/log/myapp",
+        Pattern: "access.log.*.gz",
+        GetTime: getTime,
+    }
+
+    err := w.Run(ctx)
+*/
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+
+	logsort "github.com/starsz/logsort"
+)
+
+const (
+	// defaultStableFor is used when Watcher.StableFor is unset.
+	defaultStableFor = 5 * time.Second
+	// defaultPollInterval is used when Watcher.PollInterval is unset.
+	defaultPollInterval = 2 * time.Second
+	// defaultSuffix is used when Watcher.Suffix is unset.
+	defaultSuffix = ".sorted"
+)
+
+var (
+	// ErrNeedDir returned when Watcher.Dir is empty.
+	ErrNeedDir = errors.New("watch: need dir")
+	// ErrNeedTimeHandler returned when Watcher.GetTime is nil.
+	ErrNeedTimeHandler = errors.New("watch: need time handler")
+)
+
+// BeforeSortFunc is called right before a stable matched file is sorted.
+// Returning an error skips the sort and is passed straight to AfterSort.
+type BeforeSortFunc = func(path string, info os.FileInfo) error
+
+// AfterSortFunc is called once a matched file has been sorted (or skipped
+// by BeforeSort, or failed), with the error from whichever step failed, or
+// nil on success. Typical uses are upload-to-S3, delete-original, or
+// checksum steps.
+type AfterSortFunc = func(path string, info os.FileInfo, err error)
+
+/*
+	Watcher observes Dir for files matching Pattern and, once a match's
+	size has been unchanged for StableFor, sorts it with logsort and
+	writes the result next to it with Suffix appended. Work is serialized
+	through a pool of Workers goroutines, so a burst of rotations can't
+	OOM the host.
+*/
+type Watcher struct {
+	Dir     string              // directory to watch
+	Pattern string              // glob matched against each entry's base name, e.g. "access.log.*.gz"
+	GetTime logsort.TimeHandler // the function to getTime from each line
+	Option  logsort.Option      // template; SrcFile/DstFile/GetTime/SrcCodec are overridden per file
+
+	// StableFor is how long a matched file's size must be unchanged
+	// before it's considered done rotating and is sorted. Defaults to
+	// defaultStableFor.
+	StableFor time.Duration
+	// PollInterval is how often Dir is rescanned for new or newly-stable
+	// files. Defaults to defaultPollInterval; also governs how quickly a
+	// fsnotify-driven Watcher notices a file has gone stable.
+	PollInterval time.Duration
+	// Poll, if true, rescans Dir on a ticker instead of using fsnotify.
+	// Useful on filesystems (e.g. some network mounts) where fsnotify
+	// doesn't fire reliably.
+	Poll bool
+
+	// Suffix is appended to a matched file's path to build the sorted
+	// output path. Defaults to defaultSuffix.
+	Suffix string
+	// Recompress re-applies the source file's detected Codec to the
+	// sorted output, instead of writing it uncompressed.
+	Recompress bool
+
+	// Workers bounds how many sorts run concurrently. Defaults to 1.
+	Workers int
+
+	BeforeSort BeforeSortFunc
+	AfterSort  AfterSortFunc
+
+	initOnce sync.Once
+	sem      chan struct{}
+	wg       sync.WaitGroup
+}
+
+type pendingFile struct {
+	size  int64
+	since time.Time
+}
+
+func (w *Watcher) init() {
+	if w.StableFor <= 0 {
+		w.StableFor = defaultStableFor
+	}
+
+	if w.PollInterval <= 0 {
+		w.PollInterval = defaultPollInterval
+	}
+
+	if w.Suffix == "" {
+		w.Suffix = defaultSuffix
+	}
+
+	workers := w.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	w.sem = make(chan struct{}, workers)
+}
+
+/*
+	Run watches Dir until ctx is cancelled, sorting each matched file
+	exactly once, as soon as it has been stable for StableFor. Run blocks
+	until ctx is done and every in-flight sort has finished.
+*/
+func (w *Watcher) Run(ctx context.Context) error {
+	if w.Dir == "" {
+		return ErrNeedDir
+	}
+
+	if w.GetTime == nil {
+		return ErrNeedTimeHandler
+	}
+
+	w.initOnce.Do(w.init)
+
+	defer w.wg.Wait()
+
+	if w.Poll {
+		return w.runPoll(ctx)
+	}
+
+	notify, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "new fsnotify watcher")
+	}
+
+	defer notify.Close()
+
+	if err := notify.Add(w.Dir); err != nil {
+		return errors.Wrapf(err, "watch %s", w.Dir)
+	}
+
+	return w.runNotify(ctx, notify)
+}
+
+// runPoll rescans Dir on a PollInterval ticker, which is both how it
+// discovers new files and how it notices a file has gone stable.
+func (w *Watcher) runPoll(ctx context.Context) error {
+	pending := map[string]pendingFile{}
+	processed := map[string]bool{}
+
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.scan(ctx, pending, processed); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNotify rescans Dir on fsnotify events (for quick pickup of new
+// rotations) and on a PollInterval ticker (so a file that's gone quiet is
+// still noticed as stable even without a new event).
+func (w *Watcher) runNotify(ctx context.Context, notify *fsnotify.Watcher) error {
+	pending := map[string]pendingFile{}
+	processed := map[string]bool{}
+
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.scan(ctx, pending, processed); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-notify.Errors:
+			return errors.Wrap(err, "fsnotify")
+		case <-notify.Events:
+		case <-ticker.C:
+		}
+	}
+}
+
+// scan matches Pattern against Dir's entries, updates the pending/stable
+// tracking for each, and dispatches a sort for any that just became
+// stable. processed entries whose path no longer matches (the file was
+// rotated away or deleted) are evicted, so a long-running daemon doesn't
+// leak memory for every rotated file it has ever seen.
+func (w *Watcher) scan(ctx context.Context, pending map[string]pendingFile, processed map[string]bool) error {
+	matches, err := filepath.Glob(filepath.Join(w.Dir, w.Pattern))
+	if err != nil {
+		return errors.Wrapf(err, "glob %s", w.Pattern)
+	}
+
+	current := make(map[string]bool, len(matches))
+	now := time.Now()
+
+	for _, path := range matches {
+		current[path] = true
+
+		if processed[path] {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		prev, seen := pending[path]
+		if !seen || prev.size != info.Size() {
+			pending[path] = pendingFile{size: info.Size(), since: now}
+			continue
+		}
+
+		if now.Sub(prev.since) < w.StableFor {
+			continue
+		}
+
+		processed[path] = true
+		delete(pending, path)
+
+		if !w.dispatch(ctx, path, info) {
+			return nil
+		}
+	}
+
+	for path := range processed {
+		if !current[path] {
+			delete(processed, path)
+		}
+	}
+
+	return nil
+}
+
+// dispatch sorts path in its own goroutine, bounded by Workers. It
+// reports false, without starting the sort, if ctx is done before a
+// worker slot frees up, so a burst of rotations exceeding Workers can't
+// stop scan (and therefore Run) from observing a cancelled ctx.
+func (w *Watcher) dispatch(ctx context.Context, path string, info os.FileInfo) bool {
+	select {
+	case w.sem <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+
+	w.wg.Add(1)
+
+	go func() {
+		defer w.wg.Done()
+		defer func() { <-w.sem }()
+
+		w.sortOne(path, info)
+	}()
+
+	return true
+}
+
+func (w *Watcher) sortOne(path string, info os.FileInfo) {
+	if w.BeforeSort != nil {
+		if err := w.BeforeSort(path, info); err != nil {
+			if w.AfterSort != nil {
+				w.AfterSort(path, info, err)
+			}
+
+			return
+		}
+	}
+
+	srcCodec, err := logsort.DetectFileCodec(path)
+	if err != nil {
+		if w.AfterSort != nil {
+			w.AfterSort(path, info, errors.Wrapf(err, "detect codec %s", path))
+		}
+
+		return
+	}
+
+	option := w.Option
+	option.SrcFile = path
+	option.DstFile = path + w.Suffix
+	option.GetTime = w.GetTime
+	option.SrcCodec = srcCodec
+
+	if w.Recompress {
+		option.DstCodec = srcCodec
+	}
+
+	err = logsort.SortByOption(option)
+
+	if w.AfterSort != nil {
+		w.AfterSort(path, info, err)
+	}
+}
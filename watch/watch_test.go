@@ -0,0 +1,156 @@
+package watch
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	logsort "github.com/starsz/logsort"
+)
+
+func getTime(line []byte) (int64, logsort.Action, error) {
+	tm, err := time.Parse("2006/01/02 15:04:05", string(line[:19]))
+	if err != nil {
+		return 0, logsort.SKIP, nil
+	}
+
+	return tm.Unix(), logsort.NOP, nil
+}
+
+func TestWatcherRunPollSortsStableFile(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "access.log.1")
+	if err := ioutil.WriteFile(path, []byte(
+		"2020/01/18 12:24:38 b\n2020/01/18 12:20:30 a\n"), 0644); err != nil {
+		t.Fatalf("write file: %s", err)
+	}
+
+	done := make(chan error, 1)
+
+	w := Watcher{
+		Dir:          dir,
+		Pattern:      "access.log.*",
+		GetTime:      getTime,
+		Poll:         true,
+		StableFor:    10 * time.Millisecond,
+		PollInterval: 10 * time.Millisecond,
+		AfterSort: func(path string, info os.FileInfo, err error) {
+			done <- err
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- w.Run(ctx) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("AfterSort error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for sort")
+	}
+
+	cancel()
+
+	if err := <-runErr; err != nil {
+		t.Fatalf("Run: %s", err)
+	}
+
+	content, err := ioutil.ReadFile(path + defaultSuffix)
+	if err != nil {
+		t.Fatalf("read sorted file: %s", err)
+	}
+
+	want := "2020/01/18 12:20:30 a\n2020/01/18 12:24:38 b\n"
+	if string(content) != want {
+		t.Errorf("different content, sort failed\ngot:  %q\nwant: %q", string(content), want)
+	}
+}
+
+func TestWatcherDispatchRespectsContext(t *testing.T) {
+	w := &Watcher{Workers: 1}
+	w.initOnce.Do(w.init)
+
+	// Fill the single worker slot so a further dispatch would block.
+	w.sem <- struct{}{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan bool, 1)
+	go func() { done <- w.dispatch(ctx, "unused", nil) }()
+
+	select {
+	case ok := <-done:
+		if ok {
+			t.Errorf("expected dispatch to report false once ctx is done")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("dispatch did not observe ctx.Done()")
+	}
+}
+
+func TestWatcherScanEvictsProcessed(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "access.log.1")
+	if err := ioutil.WriteFile(path, []byte("2020/01/18 12:20:30 a\n"), 0644); err != nil {
+		t.Fatalf("write file: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	w := &Watcher{
+		Dir:       dir,
+		Pattern:   "access.log.*",
+		GetTime:   getTime,
+		StableFor: time.Millisecond,
+		Workers:   1,
+		AfterSort: func(path string, info os.FileInfo, err error) { wg.Done() },
+	}
+	w.initOnce.Do(w.init)
+
+	pending := map[string]pendingFile{}
+	processed := map[string]bool{}
+	ctx := context.Background()
+
+	// First scan marks it pending (size just observed); second scan, once
+	// StableFor has elapsed, dispatches and marks it processed.
+	if err := w.scan(ctx, pending, processed); err != nil {
+		t.Fatalf("scan: %s", err)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+
+	if err := w.scan(ctx, pending, processed); err != nil {
+		t.Fatalf("scan: %s", err)
+	}
+
+	if !processed[path] {
+		t.Fatalf("expected %s to be processed", path)
+	}
+
+	wg.Wait()
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("remove file: %s", err)
+	}
+
+	if err := w.scan(ctx, pending, processed); err != nil {
+		t.Fatalf("scan: %s", err)
+	}
+
+	if processed[path] {
+		t.Errorf("expected %s to be evicted from processed once it no longer matches", path)
+	}
+}